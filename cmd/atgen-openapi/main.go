@@ -0,0 +1,42 @@
+// Command atgen-openapi reads an OpenAPI 3 / Swagger 2 document and
+// writes the atgen YAML test suite openapi.GenerateYAML derives from
+// it, giving users a one-command path from an API contract to a
+// compilable atgen test suite.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/seipan/atgen/lib/openapi"
+)
+
+func main() {
+	in := flag.String("in", "", "path to the OpenAPI 3 / Swagger 2 document (YAML or JSON)")
+	out := flag.String("out", "", "path to write the generated atgen YAML to")
+	flag.Parse()
+
+	if *in == "" || *out == "" {
+		fmt.Fprintln(os.Stderr, "usage: atgen-openapi -in <openapi-file> -out <atgen-yaml-file>")
+		os.Exit(2)
+	}
+
+	if err := run(*in, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "atgen-openapi:", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out string) error {
+	data, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	yaml, err := openapi.GenerateYAML(data)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out, yaml, 0o644)
+}
@@ -15,6 +15,7 @@ import (
 
 	util "github.com/lkesteloot/astutil"
 	"github.com/pkg/errors"
+	"github.com/seipan/atgen/snapshot"
 	"github.com/spf13/afero"
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
@@ -23,6 +24,10 @@ import (
 // RouterFuncName is function name to be replaced
 const RouterFuncName = "AtgenRouterFunc"
 
+// GRPCDialerFuncName is the function name a grpc/connect Test's dial
+// call is replaced with, parallel to RouterFuncName for HTTP.
+const GRPCDialerFuncName = "AtgenGRPCDialer"
+
 // Generate generates code and write to files
 func (g *Generator) Generate() error {
 	base := getFileNameWithoutExt(g.Yaml)
@@ -31,6 +36,9 @@ func (g *Generator) Generate() error {
 	}
 
 	tfuncs := filterTestFuncs(g.TestFuncs)
+	if err := seedSnapshots(g.OutputDir, tfuncs); err != nil {
+		return errors.WithStack(err)
+	}
 	for v, t := range tfuncs {
 		filename := fmt.Sprintf("%s_%s.go", v, base)
 		tf, err := ioutil.TempFile(g.OutputDir, filename)
@@ -62,6 +70,101 @@ func getFileNameWithoutExt(path string) string {
 	return filepath.Base(path[:len(path)-len(filepath.Ext(path))])
 }
 
+// seedSnapshots writes the testdata/ skeleton for every Test with
+// Res.Snapshot set, seeded from its Res.Params, so users can migrate to
+// snapshots gradually. It never overwrites a golden file that already
+// exists.
+func seedSnapshots(outputDir string, tfuncs map[string]TestFuncs) error {
+	for _, testFuncs := range tfuncs {
+		for _, testFunc := range testFuncs {
+			for _, t := range testFunc.Tests {
+				switch test := t.(type) {
+				case Test:
+					if err := seedSnapshot(outputDir, test); err != nil {
+						return err
+					}
+				case Subtests:
+					for _, subtest := range test {
+						for _, test := range subtest.Tests {
+							if err := seedSnapshot(outputDir, test); err != nil {
+								return err
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func seedSnapshot(outputDir string, test Test) error {
+	if !test.Res.Snapshot {
+		return nil
+	}
+	path := filepath.Join(outputDir, snapshotPath(test))
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	return snapshot.Write(path, test.Res.Params)
+}
+
+// snapshotPath is the testdata/ path a Test's golden file lives at,
+// relative to the generated _test.go file's directory.
+func snapshotPath(test Test) string {
+	if test.Res.SnapshotPath != "" {
+		return test.Res.SnapshotPath
+	}
+	name := test.Register
+	if name == "" {
+		name = strings.ToLower(test.Method) + "_" + test.Path
+	}
+	name = strings.NewReplacer("/", "_", "{", "", "}", "").Replace(name)
+	return filepath.Join("testdata", name+".json")
+}
+
+// testFuncNeedsParallelRegister reports whether any Test in testFunc can
+// run concurrently with another, either because testFunc itself is
+// Parallel or because one of its Subtests is, so its atgenRegister has
+// to be a *sync.Map instead of a plain map to stay race-free.
+func testFuncNeedsParallelRegister(testFunc TestFunc) bool {
+	if testFunc.Parallel {
+		return true
+	}
+	for _, t := range testFunc.Tests {
+		if subtests, ok := t.(Subtests); ok {
+			for _, subtest := range subtests {
+				if subtest.Parallel {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func testFuncsUseSnapshot(testFuncs TestFuncs) bool {
+	for _, testFunc := range testFuncs {
+		for _, t := range testFunc.Tests {
+			switch test := t.(type) {
+			case Test:
+				if test.Res.Snapshot {
+					return true
+				}
+			case Subtests:
+				for _, subtest := range test {
+					for _, test := range subtest.Tests {
+						if test.Res.Snapshot {
+							return true
+						}
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
 func (g *Generator) generateTestFuncs(version string, testFuncs TestFuncs, w io.Writer) error {
 	fset := token.NewFileSet()
 	f, err := parser.ParseFile(fset, g.Template, nil, parser.ParseComments)
@@ -112,18 +215,28 @@ func (g *Generator) generateTestFuncs(version string, testFuncs TestFuncs, w io.
 
 	rewriteFileAst(fset, f, testFuncs, outputPath)
 
+	if testFuncsUseSnapshot(testFuncs) {
+		astutil.AddImport(fset, f, "github.com/seipan/atgen/snapshot")
+	}
+
 	var tfnodes []ast.Node
 	for _, testFunc := range testFuncs {
 		tfnode := util.DuplicateNode(testFuncNode)
 		rewriteTestFuncNode(tfnode, testFunc, outputPath, g.Program)
 
+		// parallelRegister is decided once per TestFunc: its atgenRegister
+		// is declared a single time (see the "atgenRegister" CompositeLit
+		// case below), so every Test/Subtest inside has to agree on
+		// whether reads/writes go through the sync.Map codepath.
+		parallelRegister := testFuncNeedsParallelRegister(testFunc)
+
 		var tnodes []ast.Node
 		for _, t := range testFunc.Tests {
 			switch test := t.(type) {
 			case Test:
-				addAdditionalImports(test.Req.Type, fset, f)
+				addAdditionalImports(test.Req, test.Protocol, fset, f)
 				tnode := util.DuplicateNode(testNode)
-				tnode, err = rewriteTestNode(tnode, test)
+				tnode, err = rewriteTestNode(tnode, test, parallelRegister, outputPath, g.Program)
 				if err != nil {
 					return errors.WithStack(err)
 				}
@@ -142,11 +255,11 @@ func (g *Generator) generateTestFuncs(version string, testFuncs TestFuncs, w io.
 						return true
 					}, nil)
 
-					var tests []ast.Node
+					tests := parallelPreamble(subtest.Parallel, subtest.Fixture, outputPath, g.Program)
 					for _, test := range subtest.Tests {
-						addAdditionalImports(test.Req.Type, fset, f)
+						addAdditionalImports(test.Req, test.Protocol, fset, f)
 						tnode := util.DuplicateNode(testNode)
-						tnode, err = rewriteTestNode(tnode, test)
+						tnode, err = rewriteTestNode(tnode, test, parallelRegister, outputPath, g.Program)
 						if err != nil {
 							return errors.WithStack(err)
 						}
@@ -158,6 +271,8 @@ func (g *Generator) generateTestFuncs(version string, testFuncs TestFuncs, w io.
 			}
 		}
 
+		tnodes = append(parallelPreamble(testFunc.Parallel, testFunc.Fixture, outputPath, g.Program), tnodes...)
+
 		var ident string
 		astutil.Apply(tfnode, func(cr *astutil.Cursor) bool {
 			switch v := cr.Node().(type) {
@@ -175,6 +290,11 @@ func (g *Generator) generateTestFuncs(version string, testFuncs TestFuncs, w io.
 					h, _ := parser.ParseExpr(fmt.Sprintf("%#v", testFunc.Vars))
 					cr.Replace(h)
 				}
+				if ident == "atgenRegister" && parallelRegister {
+					h, _ := parser.ParseExpr(`&sync.Map{}`)
+					cr.Replace(h)
+					astutil.AddImport(fset, f, "sync")
+				}
 				ident = ""
 			}
 
@@ -207,6 +327,31 @@ func (g *Generator) generateTestFuncs(version string, testFuncs TestFuncs, w io.
 	return err
 }
 
+// parallelPreamble builds the leading t.Parallel() and fixture setup/
+// teardown statements a parallel TestFunc/Subtest block is injected
+// with. The fixture func's context.Context result isn't consumed by
+// anything atgen generates (no template placeholder threads it into
+// the request/router/dialer construction), so it's discarded with "_"
+// rather than bound to an unused atgenCtx, which go vet would reject.
+func parallelPreamble(parallel bool, fixture *FixtureRef, outputPath string, pkgs []*packages.Package) []ast.Node {
+	var stmts []ast.Node
+	if parallel {
+		call, _ := parser.ParseExpr(`t.Parallel()`)
+		stmts = append(stmts, &ast.ExprStmt{X: call})
+	}
+	if fixture != nil {
+		fn := resolveFuncRef(RouterFunc{Name: fixture.Name, PackagePath: fixture.PackagePath}, outputPath, pkgs)
+		setup := &ast.AssignStmt{
+			Lhs: []ast.Expr{ast.NewIdent("_"), ast.NewIdent("atgenTeardown")},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{&ast.CallExpr{Fun: fn, Args: []ast.Expr{ast.NewIdent("t")}}},
+		}
+		teardown := &ast.DeferStmt{Call: &ast.CallExpr{Fun: ast.NewIdent("atgenTeardown")}}
+		stmts = append(stmts, setup, teardown)
+	}
+	return stmts
+}
+
 func rewriteSubtestNode(subtest ast.Node, tests []ast.Node) ast.Node {
 	astutil.Apply(subtest, func(cr *astutil.Cursor) bool {
 		switch v := cr.Node().(type) {
@@ -241,6 +386,9 @@ func filterTests(testFunc TestFunc, version string) TestFunc {
 		Vars:           testFunc.Vars,
 		RouterFuncName: testFunc.RouterFuncName,
 		RouterFunc:     testFunc.RouterFunc,
+		GRPCDialer:     testFunc.GRPCDialer,
+		Parallel:       testFunc.Parallel,
+		Fixture:        testFunc.Fixture,
 	}
 	for _, t := range testFunc.Tests {
 		switch v := t.(type) {
@@ -252,7 +400,7 @@ func filterTests(testFunc TestFunc, version string) TestFunc {
 		case Subtests:
 			subtests := Subtests{}
 			for _, s := range v {
-				subtest := Subtest{Name: s.Name}
+				subtest := Subtest{Name: s.Name, Parallel: s.Parallel, Fixture: s.Fixture}
 				if s.APIVersions != nil && !contains(s.APIVersions, version) {
 					continue
 				}
@@ -321,14 +469,34 @@ func getVersions(testFunc TestFunc) []string {
 
 func rewriteFileAst(fset *token.FileSet, f *ast.File, tfuncs TestFuncs, outputPath string) {
 	for _, tfunc := range tfuncs {
-		if tfunc.RouterFunc.PackagePath == outputPath {
-			continue
+		addPkgImport(fset, f, tfunc.RouterFunc.PackagePath, outputPath)
+		addPkgImport(fset, f, tfunc.GRPCDialer.PackagePath, outputPath)
+		if tfunc.Fixture != nil {
+			addPkgImport(fset, f, tfunc.Fixture.PackagePath, outputPath)
+		}
+		for _, t := range tfunc.Tests {
+			if subtests, ok := t.(Subtests); ok {
+				for _, subtest := range subtests {
+					if subtest.Fixture != nil {
+						addPkgImport(fset, f, subtest.Fixture.PackagePath, outputPath)
+					}
+				}
+			}
 		}
-		// TODO: When package names conflict, this field should be set with a generated unique name
-		astutil.AddImport(fset, f, tfunc.RouterFunc.PackagePath)
 	}
 }
 
+// addPkgImport imports pkgPath unless it's unset (the reference wasn't
+// used) or it's the package being generated into, the same rule
+// resolveFuncRef/protoTypeName apply when resolving the reference itself.
+func addPkgImport(fset *token.FileSet, f *ast.File, pkgPath, outputPath string) {
+	if pkgPath == "" || pkgPath == outputPath {
+		return
+	}
+	// TODO: When package names conflict, this field should be set with a generated unique name
+	astutil.AddImport(fset, f, pkgPath)
+}
+
 func rewriteTestFuncNode(n ast.Node, tfunc TestFunc, outputPath string, pkgs []*packages.Package) {
 	n.(*ast.FuncDecl).Name.Name = tfunc.Name
 	astutil.Apply(n, func(cr *astutil.Cursor) bool {
@@ -336,27 +504,52 @@ func rewriteTestFuncNode(n ast.Node, tfunc TestFunc, outputPath string, pkgs []*
 		case *ast.CallExpr:
 			ident, ok := v.Fun.(*ast.Ident)
 			if ok && ident.Name == RouterFuncName {
-				if tfunc.RouterFunc.PackagePath == outputPath {
-					v.Fun = &ast.Ident{Name: tfunc.RouterFunc.Name}
-				} else {
-					var pkg *packages.Package
-					for _, p := range pkgs {
-						if p.PkgPath == tfunc.RouterFunc.PackagePath {
-							pkg = p
-						}
-					}
-					v.Fun = &ast.SelectorExpr{
-						X:   &ast.Ident{Name: pkg.Name},
-						Sel: &ast.Ident{Name: tfunc.RouterFunc.Name},
-					}
-				}
+				v.Fun = resolveFuncRef(tfunc.RouterFunc, outputPath, pkgs)
+			}
+			if ok && ident.Name == GRPCDialerFuncName {
+				v.Fun = resolveFuncRef(tfunc.GRPCDialer, outputPath, pkgs)
 			}
 		}
 		return true
 	}, nil)
 }
 
-func rewriteTestNode(n ast.Node, test Test) (ast.Node, error) {
+// resolveFuncRef turns a RouterFunc reference into the ast.Expr that
+// calls it, either a bare identifier when it lives in the package being
+// generated into, or a qualified selector otherwise.
+func resolveFuncRef(ref RouterFunc, outputPath string, pkgs []*packages.Package) ast.Expr {
+	if ref.PackagePath == outputPath {
+		return &ast.Ident{Name: ref.Name}
+	}
+	var pkg *packages.Package
+	for _, p := range pkgs {
+		if p.PkgPath == ref.PackagePath {
+			pkg = p
+		}
+	}
+	return &ast.SelectorExpr{
+		X:   &ast.Ident{Name: pkg.Name},
+		Sel: &ast.Ident{Name: ref.Name},
+	}
+}
+
+// protoTypeName renders a GRPC Req's Proto reference as the Go type
+// name generated code constructs a literal of, qualified with the
+// user's package alias unless Proto lives in the package being
+// generated into, the same rule resolveFuncRef applies to funcs.
+func protoTypeName(proto RouterFunc, outputPath string, pkgs []*packages.Package) string {
+	if proto.PackagePath == "" || proto.PackagePath == outputPath {
+		return proto.Name
+	}
+	for _, p := range pkgs {
+		if p.PkgPath == proto.PackagePath {
+			return p.Name + "." + proto.Name
+		}
+	}
+	return proto.Name
+}
+
+func rewriteTestNode(n ast.Node, test Test, parallelRegister bool, outputPath string, pkgs []*packages.Package) (ast.Node, error) {
 	var ident string
 	var err error
 	astutil.Apply(n, func(cr *astutil.Cursor) bool {
@@ -367,6 +560,8 @@ func rewriteTestNode(n ast.Node, test Test) (ast.Node, error) {
 				v.Value = fmt.Sprintf(`"%s"`, strings.ToUpper(test.Method))
 			case `"AtgenPath"`:
 				v.Value = fmt.Sprintf(`"%s"`, test.Path)
+			case `"AtgenServiceMethod"`:
+				v.Value = fmt.Sprintf(`"%s"`, test.ServiceMethod)
 			case `"atgenStatus"`:
 				v.Value = fmt.Sprintf("%d", test.Res.Status)
 			case `"atgenRegisterKey"`:
@@ -377,7 +572,7 @@ func rewriteTestNode(n ast.Node, test Test) (ast.Node, error) {
 		case *ast.CallExpr:
 			ident, ok := v.Fun.(*ast.Ident)
 			if ok && ident.Name == "AtgenRequestBody" {
-				expr := generateRequestBody(test.Req)
+				expr := generateRequestBody(test.Req, outputPath, pkgs)
 				if expr != nil {
 					cr.Replace(expr)
 				}
@@ -386,6 +581,27 @@ func rewriteTestNode(n ast.Node, test Test) (ast.Node, error) {
 			if v, ok := v.Lhs[0].(*ast.Ident); ok && test.Req.Type == RAW && v.Name == "atgenReqParams" {
 				cr.Delete()
 			}
+			if idx, ok := v.Lhs[0].(*ast.IndexExpr); ok && parallelRegister {
+				if x, ok := idx.X.(*ast.Ident); ok && x.Name == "atgenRegister" {
+					// atgenRegister is a *sync.Map when Parallel is set (see
+					// replaceRegister), so the write side has to go through
+					// Store instead of a plain map index assignment.
+					store := &ast.ExprStmt{X: &ast.CallExpr{
+						Fun: &ast.SelectorExpr{
+							X: &ast.TypeAssertExpr{
+								X:    ast.NewIdent("atgenRegister"),
+								Type: &ast.StarExpr{X: &ast.SelectorExpr{X: ast.NewIdent("sync"), Sel: ast.NewIdent("Map")}},
+							},
+							Sel: ast.NewIdent("Store"),
+						},
+						Args: []ast.Expr{
+							&ast.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("%q", test.Register)},
+							v.Rhs[0],
+						},
+					}}
+					cr.Replace(store)
+				}
+			}
 		case *ast.CompositeLit:
 			switch ident {
 			case "atgenReqHeaders":
@@ -400,6 +616,22 @@ func rewriteTestNode(n ast.Node, test Test) (ast.Node, error) {
 				h, _ := parser.ParseExpr(fmt.Sprintf("%#v", test.Res.Headers))
 				cr.Replace(h)
 			case "atgenResParams":
+				if test.Res.Snapshot {
+					p, _ := parser.ParseExpr(fmt.Sprintf(
+						`snapshot.Load(t, %q, %#v, *snapshot.Update)`, snapshotPath(test), test.Res.Params,
+					))
+					cr.Replace(p)
+					break
+				}
+				if gen, ok := assertions[test.Res.Assertion]; ok {
+					expr, genErr := gen(test)
+					if genErr != nil {
+						err = genErr
+						return false
+					}
+					cr.Replace(expr)
+					break
+				}
 				p, _ := parser.ParseExpr(fmt.Sprintf("%#v", test.Res.Params))
 				cr.Replace(p)
 			case "atgenResParamsArray":
@@ -424,7 +656,7 @@ func rewriteTestNode(n ast.Node, test Test) (ast.Node, error) {
 				t := strings.Split(s, ":")
 				v.Value = fmt.Sprintf(`atgenVars["%s"].(%s)`, t[0], t[1])
 			} else if strings.HasPrefix(v.Value, `"$atgenRegister[`) {
-				v.Value = replaceRegister(v.Value)
+				v.Value = replaceRegister(v.Value, parallelRegister)
 			}
 		}
 		return true
@@ -433,11 +665,29 @@ func rewriteTestNode(n ast.Node, test Test) (ast.Node, error) {
 	return n, err
 }
 
-func generateRequestBody(req Req) ast.Expr {
+func generateRequestBody(req Req, outputPath string, pkgs []*packages.Package) ast.Expr {
 	switch req.Type {
 	case JSON:
 		expr, _ := parser.ParseExpr(`json.Marshal(atgenReqParams)`)
 		return expr
+	case GRPC:
+		// atgenReqParams is marshaled to JSON, then protojson.Unmarshal'd
+		// into the request proto, so AtgenRequestBody yields the concrete
+		// message the RPC invocation expects rather than raw bytes.
+		protoType := protoTypeName(req.Proto, outputPath, pkgs)
+		fun := fmt.Sprintf(`func() (*%s, error) {
+			data, err := json.Marshal(atgenReqParams)
+			if err != nil {
+				return nil, err
+			}
+			msg := &%s{}
+			if err := protojson.Unmarshal(data, msg); err != nil {
+				return nil, err
+			}
+			return msg, nil
+		}()`, protoType, protoType)
+		expr, _ := parser.ParseExpr(fun)
+		return expr
 	case FORM:
 		fun := `func () ([]byte, error){
 			body := url.Values{}
@@ -468,11 +718,15 @@ func generateRequestBody(req Req) ast.Expr {
 		expr, _ := parser.ParseExpr(fun)
 		return expr
 	}
+	if gen, ok := bodyTypes[string(req.Type)]; ok {
+		expr, _ := gen(req)
+		return expr
+	}
 	return nil
 }
 
-func addAdditionalImports(typ Type, fset *token.FileSet, f *ast.File) {
-	switch typ {
+func addAdditionalImports(req Req, protocol Protocol, fset *token.FileSet, f *ast.File) {
+	switch req.Type {
 	case JSON:
 	case RAW:
 	case FORM:
@@ -480,19 +734,43 @@ func addAdditionalImports(typ Type, fset *token.FileSet, f *ast.File) {
 		astutil.AddImport(fset, f, "net/url")
 		astutil.AddImport(fset, f, "bytes")
 		astutil.AddImport(fset, f, "text/template")
-
+	case GRPC:
+		// Req.Type GRPC is shared by both Protocol grpc and connect Tests
+		// (see its doc comment), but only the former's dialer actually
+		// references the grpc package.
+		if protocol == ProtocolGRPC {
+			astutil.AddImport(fset, f, "google.golang.org/grpc")
+		}
+		astutil.AddImport(fset, f, "google.golang.org/protobuf/encoding/protojson")
+		if req.Proto.PackagePath != "" {
+			astutil.AddImport(fset, f, req.Proto.PackagePath)
+		}
+	default:
+		if gen, ok := bodyTypes[string(req.Type)]; ok {
+			_, imports := gen(req)
+			for _, imp := range imports {
+				astutil.AddImport(fset, f, imp)
+			}
+		}
 	}
 }
 
-func replaceRegister(str string) string {
+func replaceRegister(str string, parallelRegister bool) string {
 	s := strings.TrimPrefix(str, `"$atgenRegister[`)
 	s = strings.TrimSuffix(s, `]"`)
 	t := strings.Split(s, ".")
-	var value = "atgenRegister"
-	for i := 0; i < len(t); i++ {
-		if i > 0 {
-			value += ".(map[string]interface{})"
-		}
+
+	var value string
+	if parallelRegister {
+		// atgenRegister is a *sync.Map when Parallel is set, so Tests
+		// registering/reading values concurrently stay race-free.
+		value = fmt.Sprintf(`func() interface{} { v, _ := atgenRegister.(*sync.Map).Load(%q); return v }()`, t[0])
+	} else {
+		value = fmt.Sprintf(`atgenRegister["%s"]`, t[0])
+	}
+
+	for i := 1; i < len(t); i++ {
+		value += ".(map[string]interface{})"
 		if strings.Contains(t[i], "[") {
 			rep := regexp.MustCompile(`(.+)\[(\d)\]`)
 			value += rep.ReplaceAllString(t[i], `["$1"].([]interface{})[$2]`)
@@ -0,0 +1,188 @@
+package atgen
+
+import (
+	"go/ast"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+func TestResolveFuncRef(t *testing.T) {
+	pkgs := []*packages.Package{{PkgPath: "example.com/router", Name: "router"}}
+
+	t.Run("local package returns a bare ident", func(t *testing.T) {
+		expr := resolveFuncRef(RouterFunc{Name: "New", PackagePath: "example.com/out"}, "example.com/out", pkgs)
+		ident, ok := expr.(*ast.Ident)
+		if !ok || ident.Name != "New" {
+			t.Fatalf("resolveFuncRef() = %#v, want *ast.Ident{Name: \"New\"}", expr)
+		}
+	})
+
+	t.Run("external package returns a qualified selector", func(t *testing.T) {
+		expr := resolveFuncRef(RouterFunc{Name: "New", PackagePath: "example.com/router"}, "example.com/out", pkgs)
+		sel, ok := expr.(*ast.SelectorExpr)
+		if !ok {
+			t.Fatalf("resolveFuncRef() = %#v, want *ast.SelectorExpr", expr)
+		}
+		if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "router" || sel.Sel.Name != "New" {
+			t.Errorf("resolveFuncRef() = %s.%s, want router.New", sel.X, sel.Sel.Name)
+		}
+	})
+}
+
+func TestProtoTypeName(t *testing.T) {
+	pkgs := []*packages.Package{{PkgPath: "example.com/proto", Name: "pb"}}
+
+	tests := []struct {
+		name       string
+		proto      RouterFunc
+		outputPath string
+		want       string
+	}{
+		{
+			name:  "unset proto",
+			proto: RouterFunc{},
+			want:  "",
+		},
+		{
+			name:       "local package",
+			proto:      RouterFunc{Name: "Req", PackagePath: "example.com/out"},
+			outputPath: "example.com/out",
+			want:       "Req",
+		},
+		{
+			name:       "external package",
+			proto:      RouterFunc{Name: "Req", PackagePath: "example.com/proto"},
+			outputPath: "example.com/out",
+			want:       "pb.Req",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := protoTypeName(tc.proto, tc.outputPath, pkgs); got != tc.want {
+				t.Errorf("protoTypeName() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReplaceRegister(t *testing.T) {
+	tests := []struct {
+		name             string
+		str              string
+		parallelRegister bool
+		want             string
+	}{
+		{
+			name: "simple key",
+			str:  `"$atgenRegister[id]"`,
+			want: `atgenRegister["id"].(string)`,
+		},
+		{
+			name: "nested field",
+			str:  `"$atgenRegister[user.name]"`,
+			want: `atgenRegister["user"].(map[string]interface{})["name"].(string)`,
+		},
+		{
+			name: "indexed field",
+			str:  `"$atgenRegister[user.items[0]]"`,
+			want: `atgenRegister["user"].(map[string]interface{})["items"].([]interface{})[0].(string)`,
+		},
+		{
+			name:             "parallel simple key",
+			str:              `"$atgenRegister[id]"`,
+			parallelRegister: true,
+			want:             `func() interface{} { v, _ := atgenRegister.(*sync.Map).Load("id"); return v }().(string)`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := replaceRegister(tc.str, tc.parallelRegister); got != tc.want {
+				t.Errorf("replaceRegister(%q, %v) = %q, want %q", tc.str, tc.parallelRegister, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTestFuncNeedsParallelRegister(t *testing.T) {
+	tests := []struct {
+		name     string
+		testFunc TestFunc
+		want     bool
+	}{
+		{
+			name:     "not parallel",
+			testFunc: TestFunc{},
+			want:     false,
+		},
+		{
+			name:     "testFunc parallel",
+			testFunc: TestFunc{Parallel: true},
+			want:     true,
+		},
+		{
+			name: "subtest parallel",
+			testFunc: TestFunc{
+				Tests: []interface{}{Subtests{{Name: "a", Parallel: true}}},
+			},
+			want: true,
+		},
+		{
+			name: "subtest not parallel",
+			testFunc: TestFunc{
+				Tests: []interface{}{Subtests{{Name: "a"}}},
+			},
+			want: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := testFuncNeedsParallelRegister(tc.testFunc); got != tc.want {
+				t.Errorf("testFuncNeedsParallelRegister() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotPath(t *testing.T) {
+	tests := []struct {
+		name string
+		test Test
+		want string
+	}{
+		{
+			name: "explicit SnapshotPath wins",
+			test: Test{Res: Res{SnapshotPath: "testdata/custom.json"}},
+			want: "testdata/custom.json",
+		},
+		{
+			name: "derived from Register",
+			test: Test{Register: "user/{id}"},
+			want: "testdata/user_id.json",
+		},
+		{
+			name: "derived from method+path",
+			test: Test{Method: "GET", Path: "/users/{id}"},
+			want: "testdata/get__users_id.json",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := snapshotPath(tc.test); got != tc.want {
+				t.Errorf("snapshotPath() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	if !contains([]string{"a", "b"}, "b") {
+		t.Error("contains() = false, want true")
+	}
+	if contains([]string{"a", "b"}, "c") {
+		t.Error("contains() = true, want false")
+	}
+	if contains(nil, "a") {
+		t.Error("contains(nil, ...) = true, want false")
+	}
+}
@@ -0,0 +1,307 @@
+// Package openapi generates an atgen YAML test suite from an OpenAPI 3 /
+// Swagger 2 document, giving users a one-command path from an API
+// contract to a compilable atgen test suite. The result still round-trips
+// through atgen.Generator.Generate unchanged.
+package openapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	atgen "github.com/seipan/atgen/lib"
+)
+
+// Document is the subset of an OpenAPI 3 / Swagger 2 document atgen needs
+// to synthesize a YAML test suite. Only the OpenAPI 3 shapes are read
+// (requestBody, content, servers): a Swagger 2 document parses, but its
+// body parameters, consumes and response schema/examples are not read,
+// so its Tests get neither Req nor Res.Params seeded.
+type Document struct {
+	Paths   map[string]PathItem `yaml:"paths"`
+	Servers []Server            `yaml:"servers"`
+}
+
+// Server is an OpenAPI 3 server entry.
+type Server struct {
+	URL       string                    `yaml:"url"`
+	Variables map[string]ServerVariable `yaml:"variables"`
+}
+
+// ServerVariable is a templated variable in a Server URL, e.g. `version`.
+type ServerVariable struct {
+	Enum    []string `yaml:"enum"`
+	Default string   `yaml:"default"`
+}
+
+// PathItem maps an HTTP method (lowercase: "get", "post", ...) to the
+// Operation declared for it.
+type PathItem map[string]Operation
+
+// Operation is a single OpenAPI operation.
+type Operation struct {
+	Tags        []string            `yaml:"tags"`
+	OperationID string              `yaml:"operationId"`
+	RequestBody *RequestBody        `yaml:"requestBody"`
+	Responses   map[string]Response `yaml:"responses"`
+}
+
+// RequestBody is an OpenAPI requestBody object.
+type RequestBody struct {
+	Content map[string]MediaType `yaml:"content"`
+}
+
+// MediaType is an OpenAPI media type object, keyed by content type in its
+// parent map.
+type MediaType struct {
+	Schema   *Schema            `yaml:"schema"`
+	Example  interface{}        `yaml:"example"`
+	Examples map[string]Example `yaml:"examples"`
+}
+
+// Example is an OpenAPI example object.
+type Example struct {
+	Value interface{} `yaml:"value"`
+}
+
+// Schema is the subset of an OpenAPI schema object atgen reads defaults
+// from.
+type Schema struct {
+	Default    interface{}       `yaml:"default"`
+	Properties map[string]Schema `yaml:"properties"`
+}
+
+// Response is an OpenAPI response object.
+type Response struct {
+	Headers map[string]Header    `yaml:"headers"`
+	Content map[string]MediaType `yaml:"content"`
+}
+
+// Header is an OpenAPI header object, keyed by header name in its
+// parent map. Unlike a literal value, the name maps to an object
+// describing the header (schema, example, description, ...).
+type Header struct {
+	Schema      *Schema     `yaml:"schema"`
+	Example     interface{} `yaml:"example"`
+	Description string      `yaml:"description"`
+}
+
+// Parse reads an OpenAPI 3 / Swagger 2 document from raw YAML or JSON
+// bytes (JSON is valid YAML).
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &doc, nil
+}
+
+// Convert turns an OpenAPI document into an atgen.TestFuncs: operations
+// are grouped by tag into separate TestFuncs, and the `version` server
+// variable's enum is propagated into each TestFunc.APIVersions so the
+// existing filterTestFuncs version-splitting keeps working unchanged.
+func Convert(doc *Document) atgen.TestFuncs {
+	versions := apiVersions(doc)
+
+	var paths []string
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	byTag := map[string]*atgen.TestFunc{}
+	var order []string
+	for _, path := range paths {
+		item := doc.Paths[path]
+		var methods []string
+		for method := range item {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			op := item[method]
+			tag := "default"
+			if len(op.Tags) > 0 {
+				tag = op.Tags[0]
+			}
+			tf, ok := byTag[tag]
+			if !ok {
+				tf = &atgen.TestFunc{Name: testFuncName(tag), APIVersions: versions}
+				byTag[tag] = tf
+				order = append(order, tag)
+			}
+			tf.Tests = append(tf.Tests, buildTest(method, path, op))
+		}
+	}
+
+	sort.Strings(order)
+	var tfuncs atgen.TestFuncs
+	for _, tag := range order {
+		tfuncs = append(tfuncs, *byTag[tag])
+	}
+	return tfuncs
+}
+
+// GenerateYAML parses an OpenAPI document and marshals the resulting
+// atgen.TestFuncs back to YAML, for a subcommand to write straight to an
+// atgen YAML file.
+func GenerateYAML(data []byte) ([]byte, error) {
+	doc, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	out, err := yaml.Marshal(Convert(doc))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return out, nil
+}
+
+func apiVersions(doc *Document) []string {
+	for _, server := range doc.Servers {
+		if v, ok := server.Variables["version"]; ok {
+			return v.Enum
+		}
+	}
+	return nil
+}
+
+func testFuncName(tag string) string {
+	return "Test" + strings.ReplaceAll(strings.Title(strings.ReplaceAll(tag, "-", " ")), " ", "")
+}
+
+func buildTest(method, path string, op Operation) atgen.Test {
+	test := atgen.Test{
+		Method: method,
+		Path:   templatePath(path),
+	}
+
+	if op.RequestBody != nil {
+		for contentType, media := range op.RequestBody.Content {
+			test.Req.Type = reqTypeForContent(contentType)
+			if test.Req.Type == atgen.RAW {
+				// RAW's AtgenRequestBody templates Req.Body verbatim, not
+				// Req.Params (which atgen deletes outright for RAW), so
+				// seed the example there instead of silently dropping it.
+				test.Req.Body = exampleBody(media)
+			} else {
+				test.Req.Params = exampleParams(media)
+			}
+			break
+		}
+	}
+
+	status, res := firstSuccessResponse(op.Responses)
+	test.Res.Status = status
+	if res != nil {
+		test.Res.Headers = headerValues(res.Headers)
+		for _, media := range res.Content {
+			test.Res.Params = exampleParams(media)
+			break
+		}
+	}
+
+	return test
+}
+
+// templatePath rewrites every "{version}" OpenAPI path parameter, wherever
+// it appears in the path, to atgen's "{apiVersion}" template var; other
+// path parameters pass through unchanged.
+func templatePath(path string) string {
+	return strings.NewReplacer("{version}", "{apiVersion}").Replace(path)
+}
+
+// reqTypeForContent maps an OpenAPI requestBody content type to the
+// atgen.Type the generated Test should use.
+func reqTypeForContent(contentType string) atgen.Type {
+	switch {
+	case strings.Contains(contentType, "json"):
+		return atgen.JSON
+	case contentType == "application/x-www-form-urlencoded":
+		return atgen.FORM
+	default:
+		return atgen.RAW
+	}
+}
+
+// exampleBody pulls a non-JSON requestBody's example out as a plain
+// string, for Req.Body rather than the map[string]interface{} shape
+// exampleParams returns.
+func exampleBody(media MediaType) string {
+	if s, ok := media.Example.(string); ok {
+		return s
+	}
+	for _, ex := range media.Examples {
+		if s, ok := ex.Value.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// headerValues extracts each header's literal example/schema.default,
+// the same way exampleParams pulls a literal out of a MediaType,
+// dropping any header that has neither rather than seeding an
+// unresolvable schema object an actual HTTP header could never match.
+func headerValues(headers map[string]Header) map[string]interface{} {
+	var values map[string]interface{}
+	for name, h := range headers {
+		var v interface{}
+		if h.Example != nil {
+			v = h.Example
+		} else if h.Schema != nil && h.Schema.Default != nil {
+			v = h.Schema.Default
+		} else {
+			continue
+		}
+		if values == nil {
+			values = map[string]interface{}{}
+		}
+		values[name] = v
+	}
+	return values
+}
+
+func exampleParams(media MediaType) map[string]interface{} {
+	if m, ok := media.Example.(map[string]interface{}); ok {
+		return m
+	}
+	for _, ex := range media.Examples {
+		if m, ok := ex.Value.(map[string]interface{}); ok {
+			return m
+		}
+	}
+	if media.Schema != nil {
+		params := map[string]interface{}{}
+		for name, prop := range media.Schema.Properties {
+			if prop.Default != nil {
+				params[name] = prop.Default
+			}
+		}
+		if len(params) > 0 {
+			return params
+		}
+	}
+	return nil
+}
+
+func firstSuccessResponse(responses map[string]Response) (int, *Response) {
+	var codes []string
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if strings.HasPrefix(code, "2") {
+			status := 200
+			fmt.Sscanf(code, "%d", &status)
+			res := responses[code]
+			return status, &res
+		}
+	}
+	return 0, nil
+}
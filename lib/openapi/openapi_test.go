@@ -0,0 +1,197 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+
+	atgen "github.com/seipan/atgen/lib"
+)
+
+func TestReqTypeForContent(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        atgen.Type
+	}{
+		{"application/json", atgen.JSON},
+		{"application/vnd.api+json", atgen.JSON},
+		{"application/x-www-form-urlencoded", atgen.FORM},
+		{"application/xml", atgen.RAW},
+		{"application/octet-stream", atgen.RAW},
+	}
+	for _, tc := range tests {
+		if got := reqTypeForContent(tc.contentType); got != tc.want {
+			t.Errorf("reqTypeForContent(%q) = %v, want %v", tc.contentType, got, tc.want)
+		}
+	}
+}
+
+func TestExampleParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		media MediaType
+		want  map[string]interface{}
+	}{
+		{
+			name:  "example",
+			media: MediaType{Example: map[string]interface{}{"id": "1"}},
+			want:  map[string]interface{}{"id": "1"},
+		},
+		{
+			name: "examples fallback",
+			media: MediaType{
+				Examples: map[string]Example{"default": {Value: map[string]interface{}{"id": "2"}}},
+			},
+			want: map[string]interface{}{"id": "2"},
+		},
+		{
+			name: "schema defaults",
+			media: MediaType{
+				Schema: &Schema{Properties: map[string]Schema{"id": {Default: "3"}}},
+			},
+			want: map[string]interface{}{"id": "3"},
+		},
+		{
+			name:  "nothing resolvable",
+			media: MediaType{},
+			want:  nil,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exampleParams(tc.media); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("exampleParams() = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExampleBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		media MediaType
+		want  string
+	}{
+		{"example", MediaType{Example: "<foo/>"}, "<foo/>"},
+		{
+			"examples fallback",
+			MediaType{Examples: map[string]Example{"default": {Value: "<bar/>"}}},
+			"<bar/>",
+		},
+		{"nothing resolvable", MediaType{}, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := exampleBody(tc.media); got != tc.want {
+				t.Errorf("exampleBody() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHeaderValues(t *testing.T) {
+	headers := map[string]Header{
+		"X-Example":  {Example: "abc"},
+		"X-Default":  {Schema: &Schema{Default: "def"}},
+		"X-Unusable": {Description: "no example or default"},
+	}
+	want := map[string]interface{}{"X-Example": "abc", "X-Default": "def"}
+	if got := headerValues(headers); !reflect.DeepEqual(got, want) {
+		t.Errorf("headerValues() = %#v, want %#v", got, want)
+	}
+	if got := headerValues(nil); got != nil {
+		t.Errorf("headerValues(nil) = %#v, want nil", got)
+	}
+}
+
+func TestBuildTest(t *testing.T) {
+	op := Operation{
+		RequestBody: &RequestBody{
+			Content: map[string]MediaType{
+				"application/json": {Example: map[string]interface{}{"name": "foo"}},
+			},
+		},
+		Responses: map[string]Response{
+			"200": {
+				Headers: map[string]Header{"X-Request-Id": {Example: "req-1"}},
+				Content: map[string]MediaType{
+					"application/json": {Example: map[string]interface{}{"ok": true}},
+				},
+			},
+		},
+	}
+
+	test := buildTest("get", "/{version}/users", op)
+
+	if test.Method != "get" {
+		t.Errorf("Method = %q, want get", test.Method)
+	}
+	if test.Path != "/{apiVersion}/users" {
+		t.Errorf("Path = %q, want /{apiVersion}/users", test.Path)
+	}
+	if test.Req.Type != atgen.JSON {
+		t.Errorf("Req.Type = %v, want JSON", test.Req.Type)
+	}
+	if !reflect.DeepEqual(test.Req.Params, map[string]interface{}{"name": "foo"}) {
+		t.Errorf("Req.Params = %#v", test.Req.Params)
+	}
+	if test.Res.Status != 200 {
+		t.Errorf("Res.Status = %d, want 200", test.Res.Status)
+	}
+	if !reflect.DeepEqual(test.Res.Headers, map[string]interface{}{"X-Request-Id": "req-1"}) {
+		t.Errorf("Res.Headers = %#v", test.Res.Headers)
+	}
+	if !reflect.DeepEqual(test.Res.Params, map[string]interface{}{"ok": true}) {
+		t.Errorf("Res.Params = %#v", test.Res.Params)
+	}
+}
+
+func TestBuildTestRAWSeedsBody(t *testing.T) {
+	op := Operation{
+		RequestBody: &RequestBody{
+			Content: map[string]MediaType{
+				"application/xml": {Example: "<user/>"},
+			},
+		},
+	}
+
+	test := buildTest("post", "/users", op)
+
+	if test.Req.Type != atgen.RAW {
+		t.Fatalf("Req.Type = %v, want RAW", test.Req.Type)
+	}
+	if test.Req.Body != "<user/>" {
+		t.Errorf("Req.Body = %q, want <user/>", test.Req.Body)
+	}
+	if test.Req.Params != nil {
+		t.Errorf("Req.Params = %#v, want nil for RAW", test.Req.Params)
+	}
+}
+
+func TestConvertSortsPathsAndMethodsDeterministically(t *testing.T) {
+	doc := &Document{
+		Paths: map[string]PathItem{
+			"/b": {"get": Operation{}},
+			"/a": {"post": Operation{}, "get": Operation{}},
+		},
+	}
+
+	var firstPaths, firstMethods []string
+	for i := 0; i < 10; i++ {
+		tfuncs := Convert(doc)
+		var paths, methods []string
+		for _, tf := range tfuncs {
+			for _, t := range tf.Tests {
+				test := t.(atgen.Test)
+				paths = append(paths, test.Path)
+				methods = append(methods, test.Method)
+			}
+		}
+		if i == 0 {
+			firstPaths, firstMethods = paths, methods
+			continue
+		}
+		if !reflect.DeepEqual(paths, firstPaths) || !reflect.DeepEqual(methods, firstMethods) {
+			t.Fatalf("Convert() order is not deterministic: got paths %v methods %v, want %v %v", paths, methods, firstPaths, firstMethods)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package atgen
+
+import "go/ast"
+
+// BodyGenerator builds the ast.Expr that AtgenRequestBody is replaced
+// with for a custom Req.Type, plus the list of import paths the
+// generated test file needs for that expression to compile. It mirrors
+// the built-in cases of generateRequestBody / addAdditionalImports.
+type BodyGenerator func(req Req) (ast.Expr, []string)
+
+// AssertionGenerator builds the ast.Expr that replaces the
+// atgenResParams composite literal for a YAML-declared Res.Assertion
+// kind.
+type AssertionGenerator func(test Test) (ast.Expr, error)
+
+var (
+	bodyTypes  = map[string]BodyGenerator{}
+	assertions = map[string]AssertionGenerator{}
+)
+
+// RegisterBodyType registers a BodyGenerator under name so Req.Type: name
+// can be used in atgen YAML to build a request body atgen doesn't know
+// about natively (multipart/form-data, application/x-protobuf, gRPC-JSON,
+// ...), without modifying atgen itself.
+func RegisterBodyType(name string, gen BodyGenerator) {
+	bodyTypes[name] = gen
+}
+
+// RegisterAssertion registers an AssertionGenerator under name so
+// Res.Assertion: name can be used in atgen YAML to assert on a response
+// in a way atgen doesn't know about natively (equals, jsonpath, schema,
+// regex, ...), without modifying atgen itself.
+func RegisterAssertion(name string, gen AssertionGenerator) {
+	assertions[name] = gen
+}
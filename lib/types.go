@@ -0,0 +1,177 @@
+package atgen
+
+import "golang.org/x/tools/go/packages"
+
+// Type represents the encoding used to build a request body.
+type Type string
+
+// Built-in request body types.
+const (
+	JSON Type = "JSON"
+	FORM Type = "FORM"
+	RAW  Type = "RAW"
+	// GRPC marshals Req.Params as JSON, for the generated test to
+	// protojson.Unmarshal into the request proto before the RPC is
+	// invoked. Used for both Protocol: grpc and Protocol: connect Tests.
+	GRPC Type = "GRPC"
+)
+
+// Protocol selects how a Test reaches the system under test.
+type Protocol string
+
+// Supported protocols. The empty Protocol means plain HTTP, dispatched
+// through AtgenRouterFunc as before.
+const (
+	ProtocolGRPC    Protocol = "grpc"
+	ProtocolConnect Protocol = "connect"
+)
+
+// RouterFunc identifies the user's router constructor that calls to
+// AtgenRouterFunc are rewritten to invoke.
+type RouterFunc struct {
+	Name        string `yaml:"name"`
+	PackagePath string `yaml:"packagePath"`
+}
+
+// FixtureRef identifies a user's func(t testing.TB) (context.Context, func())
+// that sets up and tears down a shared fixture (DB seeding, auth token
+// minting, ...), resolved the same way RouterFunc is.
+type FixtureRef struct {
+	Name        string `yaml:"name"`
+	PackagePath string `yaml:"packagePath"`
+}
+
+// Req describes the request side of a Test.
+type Req struct {
+	Type    Type                   `yaml:"type"`
+	Headers map[string]interface{} `yaml:"headers"`
+	Params  map[string]interface{} `yaml:"params"`
+	Body    string                 `yaml:"body"`
+	// Proto identifies the user's generated proto package a GRPC-typed
+	// Req unmarshals into, resolved the same way RouterFunc is.
+	Proto RouterFunc `yaml:"proto"`
+}
+
+// Res describes the response atgen asserts a Test against.
+type Res struct {
+	Status      int                      `yaml:"status"`
+	Headers     map[string]interface{}   `yaml:"headers"`
+	Params      map[string]interface{}   `yaml:"params"`
+	ParamsArray []map[string]interface{} `yaml:"paramsArray"`
+	// Assertion names a kind registered with RegisterAssertion (e.g.
+	// "jsonpath", "schema", "regex"). When it names a registered kind and
+	// Snapshot is not set, it takes over the atgenResParams replacement
+	// instead of the literal Params above; an unregistered kind falls
+	// back to the literal Params.
+	Assertion string `yaml:"assertion"`
+	// Snapshot compares the response against a golden file under
+	// testdata/ instead of the literal Params above. SnapshotPath
+	// overrides the default path derived from the Test. Snapshot is
+	// populated from either form `snapshot` is written in, see
+	// UnmarshalYAML.
+	Snapshot     bool   `yaml:"snapshot"`
+	SnapshotPath string `yaml:"snapshotPath"`
+}
+
+// resAlias mirrors Res field-for-field, except Snapshot is left as a raw
+// interface{} so UnmarshalYAML can accept either shape it's written in.
+type resAlias struct {
+	Status       int                      `yaml:"status"`
+	Headers      map[string]interface{}   `yaml:"headers"`
+	Params       map[string]interface{}   `yaml:"params"`
+	ParamsArray  []map[string]interface{} `yaml:"paramsArray"`
+	Assertion    string                   `yaml:"assertion"`
+	Snapshot     interface{}              `yaml:"snapshot"`
+	SnapshotPath string                   `yaml:"snapshotPath"`
+}
+
+// UnmarshalYAML lets `snapshot` be written either as `true` (use the
+// default testdata/ path) or as a string path (equivalent to `snapshot:
+// true` plus that string as SnapshotPath).
+func (r *Res) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var a resAlias
+	if err := unmarshal(&a); err != nil {
+		return err
+	}
+	*r = Res{
+		Status:       a.Status,
+		Headers:      a.Headers,
+		Params:       a.Params,
+		ParamsArray:  a.ParamsArray,
+		Assertion:    a.Assertion,
+		SnapshotPath: a.SnapshotPath,
+	}
+	switch v := a.Snapshot.(type) {
+	case bool:
+		r.Snapshot = v
+	case string:
+		r.Snapshot = true
+		if r.SnapshotPath == "" {
+			r.SnapshotPath = v
+		}
+	}
+	return nil
+}
+
+// Test is a single atgen test case.
+type Test struct {
+	Method      string                 `yaml:"method"`
+	Path        string                 `yaml:"path"`
+	APIVersions []string               `yaml:"apiVersions"`
+	Register    string                 `yaml:"register"`
+	Req         Req                    `yaml:"req"`
+	Res         Res                    `yaml:"res"`
+	Vars        map[string]interface{} `yaml:"vars"`
+	// Protocol selects grpc/connect dispatch instead of HTTP. When set,
+	// ServiceMethod ("package.Service/Method") is used in place of
+	// Method+Path.
+	Protocol      Protocol `yaml:"protocol"`
+	ServiceMethod string   `yaml:"serviceMethod"`
+}
+
+// Subtest groups a set of Tests under a single t.Run name.
+type Subtest struct {
+	Name        string   `yaml:"name"`
+	APIVersions []string `yaml:"apiVersions"`
+	Tests       []Test   `yaml:"tests"`
+	// Parallel makes the generated t.Run block call t.Parallel().
+	Parallel bool `yaml:"parallel"`
+	// Fixture, if set, sets up a fixture scoped to this subtest.
+	Fixture *FixtureRef `yaml:"fixture"`
+}
+
+// Subtests is one of the two kinds of entry a TestFunc's Tests slice may
+// hold, the other being a bare Test.
+type Subtests []Subtest
+
+// TestFunc is a single generated top-level test function.
+type TestFunc struct {
+	Name           string                 `yaml:"name"`
+	Vars           map[string]interface{} `yaml:"vars"`
+	APIVersions    []string               `yaml:"apiVersions"`
+	RouterFuncName string                 `yaml:"routerFuncName"`
+	RouterFunc     RouterFunc             `yaml:"routerFunc"`
+	// GRPCDialer identifies the user's func(...) (*grpc.ClientConn, error)
+	// (or Connect equivalent) that AtgenGRPCDialer calls are rewritten to
+	// invoke, resolved the same way RouterFunc is.
+	GRPCDialer RouterFunc    `yaml:"grpcDialer"`
+	Tests      []interface{} `yaml:"tests"`
+	// Parallel makes the generated test function call t.Parallel().
+	Parallel bool `yaml:"parallel"`
+	// Fixture, if set, sets up a fixture shared across this TestFunc's
+	// Tests (and, if also parallel, safe to use from them concurrently).
+	Fixture *FixtureRef `yaml:"fixture"`
+}
+
+// TestFuncs is the top-level collection declared in an atgen YAML file.
+type TestFuncs []TestFunc
+
+// Generator drives code generation for a single atgen YAML file against
+// a single Go template.
+type Generator struct {
+	Yaml      string
+	Template  string
+	OutputDir string
+	TestFuncs TestFuncs
+	Program   []*packages.Package
+}
@@ -0,0 +1,81 @@
+// Package snapshot is the small runtime helper generated atgen tests
+// import to implement Res.Snapshot: golden-file response assertions.
+package snapshot
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Update is the "-update" flag generated tests pass as Load's update
+// argument. It is declared once here, rather than per generated file, so
+// that an API version with more than one snapshot-using TestFuncs file
+// doesn't redeclare it at package scope.
+var Update = flag.Bool("update", false, "update golden files")
+
+// Load reads the canonical JSON golden file at path and decodes it into
+// a map[string]interface{}. When update is true, or the file does not
+// yet exist, fallback is canonicalized and written to path first, then
+// returned, so golden files can be seeded and refreshed with `go test
+// -update`.
+func Load(t testing.TB, path string, fallback map[string]interface{}, update bool) map[string]interface{} {
+	t.Helper()
+
+	if update {
+		if err := Write(path, fallback); err != nil {
+			t.Fatalf("snapshot: writing golden file %s: %v", path, err)
+		}
+		return fallback
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		if err := Write(path, fallback); err != nil {
+			t.Fatalf("snapshot: seeding golden file %s: %v", path, err)
+		}
+		return fallback
+	}
+	if err != nil {
+		t.Fatalf("snapshot: reading golden file %s: %v", path, err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("snapshot: decoding golden file %s: %v", path, err)
+	}
+	return got
+}
+
+// Write canonicalizes v and writes it to path, creating its parent
+// testdata directory if needed.
+func Write(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := Canonicalize(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0o644)
+}
+
+// Canonicalize marshals v to a stable JSON form: encoding/json already
+// sorts map[string]interface{} keys on Marshal, and round-tripping
+// through a generic value normalizes numbers (e.g. 1 vs 1.0) to a single
+// representation, so two semantically-equal values produce
+// byte-identical output.
+func Canonicalize(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(generic, "", "  ")
+}
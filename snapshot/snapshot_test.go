@@ -0,0 +1,55 @@
+package snapshot
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalizeNormalizesNumbersAndKeyOrder(t *testing.T) {
+	a, err := Canonicalize(map[string]interface{}{"b": 1.0, "a": 1})
+	if err != nil {
+		t.Fatalf("Canonicalize() error = %v", err)
+	}
+	b, err := Canonicalize(map[string]interface{}{"a": 1, "b": 1})
+	if err != nil {
+		t.Fatalf("Canonicalize() error = %v", err)
+	}
+	if string(a) != string(b) {
+		t.Errorf("Canonicalize() not stable across equal values: %q != %q", a, b)
+	}
+}
+
+func TestLoadSeedsGoldenFileWhenMissing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "testdata", "foo.json")
+	fallback := map[string]interface{}{"ok": true}
+
+	got := Load(t, path, fallback, false)
+	if !reflect.DeepEqual(got, fallback) {
+		t.Errorf("Load() = %#v, want %#v", got, fallback)
+	}
+
+	got2 := Load(t, path, map[string]interface{}{"ok": false}, false)
+	if !reflect.DeepEqual(got2, fallback) {
+		t.Errorf("Load() after seeding = %#v, want the seeded golden file %#v", got2, fallback)
+	}
+}
+
+func TestLoadOverwritesWhenUpdateIsSet(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "testdata", "foo.json")
+
+	Load(t, path, map[string]interface{}{"ok": false}, false)
+
+	updated := map[string]interface{}{"ok": true}
+	got := Load(t, path, updated, true)
+	if !reflect.DeepEqual(got, updated) {
+		t.Errorf("Load() with update=true = %#v, want %#v", got, updated)
+	}
+
+	got2 := Load(t, path, map[string]interface{}{"ok": false}, false)
+	if !reflect.DeepEqual(got2, updated) {
+		t.Errorf("Load() after update = %#v, want %#v", got2, updated)
+	}
+}